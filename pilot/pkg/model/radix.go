@@ -15,17 +15,84 @@
 package model
 
 import (
-	"github.com/hashicorp/go-immutable-radix"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-immutable-radix"
 )
 
-// TODO: if there are conflicts, pick the oldest config
+// Namespace tokens recognized in namespace-qualified hostnames of the form "namespace/host",
+// mirroring the convention already used by Gateway and VirtualService host entries.
+const (
+	// currentNamespace ("./host") scopes host to the namespace of the config that declares it.
+	currentNamespace = "."
+	// anyNamespace ("*/host") scopes host to every namespace.
+	anyNamespace = "*"
+	// namespaceSeparator divides the namespace token from the reversed hostname inside a radix key.
+	namespaceSeparator = 0
+)
 
+// hostLookup is the read-only surface over the host index. Snapshot returns a value
+// satisfying this interface that stays stable for its lifetime, independent of later writes.
 type hostLookup interface {
-	Lookup(hostname Hostname) map[Hostname]Config
+	// Lookup returns the most specific configs matching hostname as seen from namespace,
+	// restricted to configs whose namespace is exactly namespace or was inserted under "*".
+	// Configs sharing a hostname are ordered oldest first by ConfigMeta.CreationTimestamp,
+	// ties broken by namespace then name, so conflicts resolve the same way regardless of
+	// insertion order.
+	Lookup(namespace string, hostname Hostname) map[Hostname][]Config
+	// LookupRanked returns the same matches as Lookup, but as a flat, ordered []Match so
+	// callers that need to tell an exact match from a wildcard one - or that must fold
+	// matches in a defined order, such as Envoy virtual_host or SNI filter chain generation -
+	// don't have to re-derive specificity from the hostname themselves.
+	LookupRanked(namespace string, hostname Hostname) []Match
+	// Winner returns, for each hostname matched by Lookup, only the single oldest config.
+	Winner(namespace string, hostname Hostname) map[Hostname]Config
+}
+
+// MatchKind classifies how a Match's config hostname matched the query.
+type MatchKind int
+
+const (
+	// MatchExact means the config hostname had no wildcard, e.g. "abc.def".
+	MatchExact MatchKind = iota
+	// MatchSuffixWildcard means the config hostname was a leading wildcard, e.g. "*.def".
+	MatchSuffixWildcard
+	// MatchCatchAll means the config hostname was the bare wildcard "*".
+	MatchCatchAll
+)
+
+func (k MatchKind) String() string {
+	switch k {
+	case MatchExact:
+		return "exact"
+	case MatchSuffixWildcard:
+		return "suffix-wildcard"
+	case MatchCatchAll:
+		return "catch-all"
+	default:
+		return "unknown"
+	}
+}
+
+// Match is a single config returned by LookupRanked, carrying enough information for a
+// caller to fold it into Envoy config in priority order without re-deriving specificity.
+type Match struct {
+	Hostname Hostname
+	Config   Config
+	// Specificity is the number of characters of exact overlap with the query hostname, as
+	// defined in the doc comment on Lookup below. Higher is more specific.
+	Specificity int
+	Kind        MatchKind
 }
 
+// radix indexes configs by namespace-qualified hostname on top of an immutable radix tree.
+// The tree itself never mutates in place; Insert/Delete/BulkReplace each swap in a new root
+// under mu, so a reader that captured the old *iradix.Tree (directly, or via Snapshot) keeps
+// seeing a complete, self-consistent view even while a writer is in progress.
 type radix struct {
+	mu    sync.RWMutex
 	radix *iradix.Tree
 }
 
@@ -60,51 +127,387 @@ func newRadix() *radix {
 //   thus, the most specific matches are "abc.def" and "*.def"
 //
 // This function uses a radix to implement the behavior described above.
-func (r *radix) Lookup(hostname Hostname) map[Hostname]Config {
-	configs := make(map[Hostname]Config)
+//
+// Every config is additionally scoped to a namespace. A config inserted under the literal
+// namespace "foo" is only visible to a Lookup from namespace "foo"; a config inserted under
+// "*" (any namespace) is visible from every namespace. The namespace dimension is folded into
+// the radix key ahead of the reversed hostname, so a Lookup only ever walks the subtrees for
+// namespace and for "*" instead of scanning every namespace in the tree.
+//
+// Lookup is a thin wrapper over LookupRanked that folds ranked matches back into a map, kept
+// for callers that only care which configs matched and not their relative specificity.
+func (r *radix) Lookup(namespace string, hostname Hostname) map[Hostname][]Config {
+	return foldMatches(r.LookupRanked(namespace, hostname))
+}
+
+// LookupRanked returns every matching config as a flat []Match, most specific first, so
+// callers that need to distinguish an exact match from a wildcard one - or that must
+// preserve a specific fold order, such as Envoy virtual_host or SNI filter chain generation -
+// don't have to re-derive specificity from the hostname themselves.
+func (r *radix) LookupRanked(namespace string, hostname Hostname) []Match {
+	return rankedLookup(r.tree(), namespace, hostname)
+}
+
+// Winner returns, for each hostname matched by Lookup, only the single oldest config -
+// the one that should win when VirtualService/DestinationRule merging must pick exactly
+// one config per hostname.
+func (r *radix) Winner(namespace string, hostname Hostname) map[Hostname]Config {
+	return winner(r.tree(), namespace, hostname)
+}
+
+// tree takes a consistent snapshot of the current root under a read lock. Because the
+// underlying iradix.Tree is immutable, the caller can walk it afterwards without holding mu.
+func (r *radix) tree() *iradix.Tree {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.radix
+}
+
+// Snapshot returns an immutable view of the index as of now. Because the underlying tree is
+// itself immutable, the returned hostLookup can be queried many times across a single push to
+// pilot-discovery without re-taking a lock or ever observing a write that happens afterwards.
+func (r *radix) Snapshot() hostLookup {
+	return &radixSnapshot{tree: r.tree()}
+}
+
+// radixSnapshot is a point-in-time, lock-free view over an immutable radix tree.
+type radixSnapshot struct {
+	tree *iradix.Tree
+}
+
+func (s *radixSnapshot) Lookup(namespace string, hostname Hostname) map[Hostname][]Config {
+	return foldMatches(rankedLookup(s.tree, namespace, hostname))
+}
+
+func (s *radixSnapshot) LookupRanked(namespace string, hostname Hostname) []Match {
+	return rankedLookup(s.tree, namespace, hostname)
+}
+
+func (s *radixSnapshot) Winner(namespace string, hostname Hostname) map[Hostname]Config {
+	return winner(s.tree, namespace, hostname)
+}
+
+// rankedLookup runs lookup and flattens the result into Match values ordered most specific
+// first (ties broken by hostname), preserving each hostname's existing oldest-first config
+// order from lookup.
+//
+// Specificity is the number of characters of the query hostname that were matched exactly,
+// as defined in the doc comment on Lookup above. The catch-all "*" always has 0 characters of
+// overlap, however it was reached. Otherwise, when hostname itself contains a wildcard, every
+// other match found by the wildcard walk shares the same overlap - the stripped query hostname
+// itself - since any characters of a matched host beyond that point were never part of the
+// query to begin with. In every other case (a literal query hostname, or a wildcard query that
+// fell back to the longest-prefix walk), the overlap is exactly the matched host's length.
+func rankedLookup(tree *iradix.Tree, namespace string, hostname Hostname) []Match {
+	matches := lookup(tree, namespace, hostname)
+
+	wildcardQuery := strings.Contains(string(hostname), "*")
+	strippedQueryLen := len(strings.Replace(string(hostname), "*", "", -1))
+
+	ranked := make([]Match, 0, len(matches))
+	for host, configs := range matches {
+		kind := classifyMatchKind(host)
+		specificity := len(host)
+		switch {
+		case kind == MatchCatchAll:
+			specificity = 0
+		case wildcardQuery && strippedQueryLen < specificity:
+			specificity = strippedQueryLen
+		}
+		for _, config := range configs {
+			ranked = append(ranked, Match{
+				Hostname:    host,
+				Config:      config,
+				Specificity: specificity,
+				Kind:        kind,
+			})
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Specificity != ranked[j].Specificity {
+			return ranked[i].Specificity > ranked[j].Specificity
+		}
+		return ranked[i].Hostname < ranked[j].Hostname
+	})
+	return ranked
+}
+
+// classifyMatchKind derives a Match's Kind from its already-resolved Hostname: an empty
+// host came from the bare wildcard "*", and a host beginning with "." came from stripping
+// the wildcard off a leading "*.", e.g. "*.def" is stored and returned as ".def".
+func classifyMatchKind(host Hostname) MatchKind {
+	switch {
+	case len(host) == 0:
+		return MatchCatchAll
+	case strings.HasPrefix(string(host), "."):
+		return MatchSuffixWildcard
+	default:
+		return MatchExact
+	}
+}
+
+// foldMatches collapses ranked Match values back into Lookup's map[Hostname][]Config shape,
+// preserving each hostname's relative config order.
+func foldMatches(matches []Match) map[Hostname][]Config {
+	configs := make(map[Hostname][]Config)
+	for _, m := range matches {
+		configs[m.Hostname] = append(configs[m.Hostname], m.Config)
+	}
+	return configs
+}
+
+func lookup(tree *iradix.Tree, namespace string, hostname Hostname) map[Hostname][]Config {
 	wildcard := strings.Contains(string(hostname), "*")
 
-	// If a wildcard is present in the query hostname there may be multiple equally specific matches,
-	// so we attempt to walk every config hostname under this prefix.
 	if wildcard {
-		r.radix.Root().WalkPrefix(r.toKey(hostname), func(k []byte, v interface{}) bool {
-			config, _ := v.(Config)
-			configs[r.fromKey(k)] = config
-			return false
-		})
+		configs := make(map[Hostname][]Config)
+		walkNamespace(tree, namespace, hostname, configs)
+		if namespace != anyNamespace {
+			walkNamespace(tree, anyNamespace, hostname, configs)
+		}
+		if len(configs) > 0 {
+			return configs
+		}
+	}
+
+	return longestPrefixAcrossNamespaces(tree, namespace, hostname)
+}
+
+func winner(tree *iradix.Tree, namespace string, hostname Hostname) map[Hostname]Config {
+	matches := lookup(tree, namespace, hostname)
+	winners := make(map[Hostname]Config, len(matches))
+	for host, configs := range matches {
+		winners[host] = configs[0]
+	}
+	return winners
+}
+
+// walkNamespace collects every config under nsToken whose hostname shares the query's wildcard
+// prefix, merging into any configs already collected for the same hostname under a different
+// namespace scope.
+func walkNamespace(tree *iradix.Tree, nsToken string, hostname Hostname, configs map[Hostname][]Config) {
+	tree.Root().WalkPrefix(toKey(nsToken, hostname), func(k []byte, v interface{}) bool {
+		host := fromKey(k)
+		configs[host] = mergeConfigs(configs[host], v.([]Config))
+		return false
+	})
+}
+
+// longestPrefixAcrossNamespaces handles the non-wildcard-query case: it finds the longest
+// matching config host in namespace and in "*", and keeps whichever matched more of the
+// hostname, merging the two when they resolve to the same hostname with equal specificity.
+func longestPrefixAcrossNamespaces(tree *iradix.Tree, namespace string, hostname Hostname) map[Hostname][]Config {
+	configs := make(map[Hostname][]Config)
+
+	hostKey, hostVal, hostOK := tree.Root().LongestPrefix(toKey(namespace, hostname))
+	if namespace == anyNamespace {
+		if hostOK {
+			configs[fromKey(hostKey)] = hostVal.([]Config)
+		}
+		return configs
 	}
 
-	// If the query hostname has no wildcard, or there were no configs under the prefix, we get the
-	// longest matching prefix for this query hostname.
-	if !wildcard || len(configs) == 0 {
-		k, v, _ := r.radix.Root().LongestPrefix(r.toKey(hostname))
-		config, _ := v.(Config)
-		configs[r.fromKey(k)] = config
+	anyKey, anyVal, anyOK := tree.Root().LongestPrefix(toKey(anyNamespace, hostname))
+
+	switch {
+	case hostOK && anyOK && hostLen(hostKey) == hostLen(anyKey) && fromKey(hostKey) == fromKey(anyKey):
+		configs[fromKey(hostKey)] = mergeConfigs(hostVal.([]Config), anyVal.([]Config))
+	case hostOK && (!anyOK || hostLen(hostKey) >= hostLen(anyKey)):
+		configs[fromKey(hostKey)] = hostVal.([]Config)
+	case anyOK:
+		configs[fromKey(anyKey)] = anyVal.([]Config)
 	}
 
 	return configs
 }
 
-func (r *radix) Insert(hostname Hostname, config Config) {
-	r.radix, _, _ = r.radix.Insert(r.toKey(hostname), config)
+func (r *radix) Insert(namespace string, hostname Hostname, config Config) {
+	token, host := splitNamespacedHostname(namespace, hostname)
+	key := toKey(token, host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var configs []Config
+	if existing, ok := r.radix.Get(key); ok {
+		configs = existing.([]Config)
+	}
+	r.radix, _, _ = r.radix.Insert(key, insertSorted(configs, config))
+}
+
+// Delete removes config from the configs indexed under the namespace-qualified hostname,
+// following the same "." and "*" resolution as Insert, and identifies config by its
+// Namespace and Name so the rest of the slice Insert accumulated under that hostname (per
+// chunk0-2's conflict ordering) is left untouched. It is a no-op if config is not indexed
+// there.
+func (r *radix) Delete(namespace string, hostname Hostname, config Config) {
+	token, host := splitNamespacedHostname(namespace, hostname)
+	key := toKey(token, host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.radix.Get(key)
+	if !ok {
+		return
+	}
+
+	configs := existing.([]Config)
+	remaining := removeConfig(configs, config)
+	switch {
+	case len(remaining) == len(configs):
+		// config wasn't present: leave the tree untouched rather than swapping in a new root
+		// that a concurrent Snapshot would have to pin for no reason.
+		return
+	case len(remaining) == 0:
+		r.radix, _, _ = r.radix.Delete(key)
+	default:
+		r.radix, _, _ = r.radix.Insert(key, remaining)
+	}
+}
+
+// removeConfig returns configs with the entry matching target's Namespace and Name removed,
+// preserving the relative order (and thus the CreationTimestamp ordering Lookup promises) of
+// everything else. The result is always reallocated with no spare capacity, even when nothing
+// is removed, so a later Insert on the same key can never append into (and so mutate) a slice
+// a concurrent Snapshot or Lookup is still holding.
+func removeConfig(configs []Config, target Config) []Config {
+	remaining := make([]Config, 0, len(configs))
+	for _, config := range configs {
+		if config.Namespace == target.Namespace && config.Name == target.Name {
+			continue
+		}
+		remaining = append(remaining, config)
+	}
+	return remaining[:len(remaining):len(remaining)]
+}
+
+// radixEntry is one config to (re-)index, carrying the same (namespace, hostname, config)
+// triple Insert takes, so BulkReplace can resolve a plain or "./host" hostname against the
+// namespace that actually owns it instead of leaving it namespace-less and unreachable.
+type radixEntry struct {
+	Namespace string
+	Hostname  Hostname
+	Config    Config
 }
 
-// Strips the wildcard character '*' and stores the hostname in the radix in reversed character order.
-func (r *radix) toKey(hostname Hostname) []byte {
+// BulkReplace atomically swaps the entire index to contain exactly entries, so a config-store
+// reload never exposes a partially-built tree to concurrent Lookups or Snapshots. Each entry
+// resolves its namespace token exactly as Insert does: a plain hostname or a "./host" is scoped
+// to entry.Namespace, and "ns2/host" or "*/host" are honored as explicit overrides.
+func (r *radix) BulkReplace(entries []radixEntry) {
+	next := iradix.New()
+	for _, entry := range entries {
+		token, host := splitNamespacedHostname(entry.Namespace, entry.Hostname)
+		key := toKey(token, host)
+
+		var configs []Config
+		if existing, ok := next.Get(key); ok {
+			configs = existing.([]Config)
+		}
+		next, _, _ = next.Insert(key, insertSorted(configs, entry.Config))
+	}
+
+	r.mu.Lock()
+	r.radix = next
+	r.mu.Unlock()
+}
+
+// insertSorted returns configs with config inserted in the order Lookup promises: oldest
+// CreationTimestamp first, ties broken by namespace then name. Keeping the slice sorted on
+// every Insert means conflicting configs resolve deterministically no matter what order
+// they were added in, resolving the prior "oldest config wins" TODO. The result is always a
+// newly allocated slice and configs itself is left unmodified, so a slice still held by an
+// older tree or a Snapshot never changes underneath its reader.
+func insertSorted(configs []Config, config Config) []Config {
+	i := sort.Search(len(configs), func(i int) bool {
+		return configLess(config, configs[i])
+	})
+	out := make([]Config, 0, len(configs)+1)
+	out = append(out, configs[:i]...)
+	out = append(out, config)
+	return append(out, configs[i:]...)
+}
+
+// mergeConfigs merges two already-sorted config slices, preserving the CreationTimestamp
+// order Lookup promises.
+func mergeConfigs(a, b []Config) []Config {
+	merged := make([]Config, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	for _, config := range b {
+		merged = insertSorted(merged, config)
+	}
+	return merged
+}
+
+// configLess reports whether a should resolve before b: oldest CreationTimestamp first,
+// ties broken by namespace then name.
+func configLess(a, b Config) bool {
+	if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// splitNamespacedHostname splits a "namespace/host" hostname into its namespace token and
+// host. Hostnames with no "/" are treated as scoped to namespace. A "." token resolves to
+// namespace, the namespace of the config being inserted.
+func splitNamespacedHostname(namespace string, hostname Hostname) (string, Hostname) {
+	s := string(hostname)
+	idx := strings.IndexByte(s, '/')
+	if idx < 0 {
+		return namespace, hostname
+	}
+	token, host := s[:idx], s[idx+1:]
+	if token == currentNamespace {
+		token = namespace
+	}
+	return token, Hostname(host)
+}
+
+// Strips the wildcard character '*' and stores the hostname in the radix in reversed character
+// order, prefixed with the namespace token so lookups only walk the relevant namespace subtree.
+func toKey(namespace string, hostname Hostname) []byte {
 	s := strings.Replace(string(hostname), "*", "", -1)
 	data := []byte(s)
 	reverse(data)
-	return data
+
+	key := make([]byte, 0, len(namespace)+1+len(data))
+	key = append(key, namespace...)
+	key = append(key, namespaceSeparator)
+	key = append(key, data...)
+	return key
 }
 
-// Unreverses the hostname.
-func (r *radix) fromKey(key []byte) Hostname {
-	data := make([]byte, len(key))
-	copy(data, key)
+// Unreverses the hostname portion of a key, dropping the namespace token.
+func fromKey(key []byte) Hostname {
+	host := key[hostOffset(key):]
+	data := make([]byte, len(host))
+	copy(data, host)
 	reverse(data)
 	return Hostname(data)
 }
 
+// hostOffset returns the index of the first byte of the hostname portion of key, i.e. the
+// byte immediately after the namespace separator.
+func hostOffset(key []byte) int {
+	for i, b := range key {
+		if b == namespaceSeparator {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// hostLen returns the length, in bytes, of the hostname portion of key.
+func hostLen(key []byte) int {
+	return len(key) - hostOffset(key)
+}
+
 func reverse(data []byte) {
 	for i := 0; i < len(data)/2; i++ {
 		data[i], data[len(data)-i-1] = data[len(data)-i-1], data[i]
@@ -14,9 +14,14 @@
 package model
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
+const testNamespace = "default"
+
 func TestRadix(t *testing.T) {
 	r := newRadix()
 
@@ -34,7 +39,7 @@ func TestRadix(t *testing.T) {
 
 	for _, content := range contents {
 		for _, hostname := range content.hostnames {
-			r.Insert(hostname, content.config)
+			r.Insert(testNamespace, hostname, content.config)
 		}
 	}
 
@@ -58,7 +63,7 @@ func TestRadix(t *testing.T) {
 	}
 
 	for _, tt := range testCases {
-		configs := r.Lookup(tt.in)
+		configs := r.Lookup(testNamespace, tt.in)
 		if len(tt.out) != len(configs) {
 			t.Errorf("f(%v) -> wanted len()=%v, got len()=%v", tt.in, len(tt.out), len(configs))
 			t.Errorf("%#v", configs)
@@ -70,3 +75,397 @@ func TestRadix(t *testing.T) {
 		}
 	}
 }
+
+func TestRadixNamespaceScoping(t *testing.T) {
+	r := newRadix()
+
+	selfNS := Config{ConfigMeta: ConfigMeta{Name: "self-ns"}}
+	otherNS := Config{ConfigMeta: ConfigMeta{Name: "other-ns"}}
+	anyNS := Config{ConfigMeta: ConfigMeta{Name: "any-ns"}}
+
+	// "./host" resolves to the namespace of the config being inserted.
+	r.Insert("ns1", "./self.example.com", selfNS)
+	// an explicit namespace targets that namespace regardless of who inserts it.
+	r.Insert("ns1", "ns2/other.example.com", otherNS)
+	// "*/host" is visible from every namespace.
+	r.Insert("ns1", "*/any.example.com", anyNS)
+
+	testCases := []struct {
+		namespace string
+		in        Hostname
+		want      *Config
+	}{
+		{"ns1", "self.example.com", &selfNS},
+		{"ns2", "self.example.com", nil},
+		{"ns2", "other.example.com", &otherNS},
+		{"ns1", "other.example.com", nil},
+		{"ns1", "any.example.com", &anyNS},
+		{"anything", "any.example.com", &anyNS},
+	}
+
+	for _, tt := range testCases {
+		configs := r.Lookup(tt.namespace, tt.in)
+		if tt.want == nil {
+			if len(configs) != 0 {
+				t.Errorf("Lookup(%v, %v) -> wanted no match, got %#v", tt.namespace, tt.in, configs)
+			}
+			continue
+		}
+		matches, ok := configs[tt.in]
+		if !ok || len(matches) != 1 || matches[0].Name != tt.want.Name {
+			t.Errorf("Lookup(%v, %v) -> wanted %v, got %#v", tt.namespace, tt.in, tt.want.Name, configs)
+		}
+	}
+}
+
+func TestRadixConflictOrdering(t *testing.T) {
+	oldest := Config{ConfigMeta: ConfigMeta{
+		Namespace:         "default",
+		Name:              "oldest",
+		CreationTimestamp: time.Unix(1, 0),
+	}}
+	middle := Config{ConfigMeta: ConfigMeta{
+		Namespace:         "default",
+		Name:              "middle",
+		CreationTimestamp: time.Unix(2, 0),
+	}}
+	newest := Config{ConfigMeta: ConfigMeta{
+		Namespace:         "default",
+		Name:              "newest",
+		CreationTimestamp: time.Unix(3, 0),
+	}}
+
+	// The winner should not depend on insertion order.
+	orderings := [][]Config{
+		{oldest, middle, newest},
+		{newest, oldest, middle},
+		{middle, newest, oldest},
+	}
+
+	for _, ordering := range orderings {
+		r := newRadix()
+		for _, config := range ordering {
+			r.Insert(testNamespace, "conflict.example.com", config)
+		}
+
+		matches := r.Lookup(testNamespace, "conflict.example.com")["conflict.example.com"]
+		if len(matches) != 3 {
+			t.Fatalf("Lookup -> wanted 3 configs, got %#v", matches)
+		}
+		wantOrder := []string{"oldest", "middle", "newest"}
+		for i, want := range wantOrder {
+			if matches[i].Name != want {
+				t.Errorf("Lookup order %v -> position %d: wanted %v, got %v", ordering, i, want, matches[i].Name)
+			}
+		}
+
+		winner := r.Winner(testNamespace, "conflict.example.com")["conflict.example.com"]
+		if winner.Name != "oldest" {
+			t.Errorf("Winner(%v) -> wanted %v, got %v", ordering, "oldest", winner.Name)
+		}
+	}
+}
+
+func TestRadixConflictTieBreak(t *testing.T) {
+	same := time.Unix(1, 0)
+	a := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "b-config", CreationTimestamp: same}}
+	b := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "a-config", CreationTimestamp: same}}
+
+	r := newRadix()
+	r.Insert(testNamespace, "tie.example.com", a)
+	r.Insert(testNamespace, "tie.example.com", b)
+
+	winner := r.Winner(testNamespace, "tie.example.com")["tie.example.com"]
+	if winner.Name != "a-config" {
+		t.Errorf("Winner() with equal timestamps -> wanted the alphabetically-first name %v, got %v", "a-config", winner.Name)
+	}
+}
+
+func TestRadixLookupRanked(t *testing.T) {
+	r := newRadix()
+
+	exact := Config{ConfigMeta: ConfigMeta{Name: "abc.def"}}
+	suffix := Config{ConfigMeta: ConfigMeta{Name: "*.def"}}
+	catchAll := Config{ConfigMeta: ConfigMeta{Name: "*"}}
+
+	r.Insert(testNamespace, "abc.def", exact)
+	r.Insert(testNamespace, "*.def", suffix)
+	r.Insert(testNamespace, "*", catchAll)
+
+	// Per the Lookup doc comment, "abc.def" and "*.def" are equally specific matches for the
+	// query "*.def": both have an exact match of the 4 characters of ".def" with the query
+	// host, and the extra "abc" on the exact match was never asked for by the query. As with
+	// Lookup, a wildcard query never walks into the bare "*" catch-all (see TestRadix's "*.com"
+	// and "*.cnn.com" cases), so only the two tied matches are returned here.
+	matches := r.LookupRanked(testNamespace, "*.def")
+	if len(matches) != 2 {
+		t.Fatalf("LookupRanked(*.def) -> wanted 2 matches, got %#v", matches)
+	}
+
+	for _, m := range matches {
+		if m.Specificity != 4 {
+			t.Errorf("LookupRanked(*.def) -> match %v wanted Specificity 4, got %v", m.Config.Name, m.Specificity)
+		}
+		var wantKind MatchKind
+		switch m.Config.Name {
+		case "abc.def":
+			wantKind = MatchExact
+		case "*.def":
+			wantKind = MatchSuffixWildcard
+		default:
+			t.Fatalf("LookupRanked(*.def) -> unexpected match %#v", m)
+		}
+		if m.Kind != wantKind {
+			t.Errorf("LookupRanked(*.def) -> match %v wanted Kind %v, got %v", m.Config.Name, wantKind, m.Kind)
+		}
+	}
+
+	// A query that falls through to the longest-prefix path (no wildcard of its own, and
+	// nothing more specific than the catch-all) surfaces "*" as a single, least-specific match.
+	fallback := r.LookupRanked(testNamespace, "nothing.nowhere.net")
+	if len(fallback) != 1 || fallback[0].Config.Name != "*" || fallback[0].Kind != MatchCatchAll || fallback[0].Specificity != 0 {
+		t.Errorf("LookupRanked(nothing.nowhere.net) -> wanted a single catch-all match at specificity 0, got %#v", fallback)
+	}
+
+	// A wildcard query itself can also fall through to the catch-all, when WalkPrefix finds
+	// nothing more specific: the catch-all must still report 0 characters of overlap, not the
+	// length of the query's stripped-wildcard portion.
+	wildcardFallback := r.LookupRanked(testNamespace, "*.totally.unmatched.example")
+	if len(wildcardFallback) != 1 || wildcardFallback[0].Config.Name != "*" ||
+		wildcardFallback[0].Kind != MatchCatchAll || wildcardFallback[0].Specificity != 0 {
+		t.Errorf("LookupRanked(*.totally.unmatched.example) -> wanted a single catch-all match at specificity 0, got %#v", wildcardFallback)
+	}
+
+	// Lookup stays a thin wrapper over LookupRanked: same configs, just folded into a map.
+	folded := r.Lookup(testNamespace, "*.def")
+	if len(folded) != 2 {
+		t.Errorf("Lookup(*.def) -> wanted 2 hostnames, got %#v", folded)
+	}
+}
+
+func TestRadixDelete(t *testing.T) {
+	r := newRadix()
+
+	a := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "a", CreationTimestamp: time.Unix(1, 0)}}
+	b := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "b", CreationTimestamp: time.Unix(2, 0)}}
+	c := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "c", CreationTimestamp: time.Unix(3, 0)}}
+
+	r.Insert(testNamespace, "conflict.example.com", a)
+	r.Insert(testNamespace, "conflict.example.com", b)
+	r.Insert(testNamespace, "conflict.example.com", c)
+
+	// Deleting one config out of several sharing a hostname must leave the others - and their
+	// relative CreationTimestamp order - untouched, since Insert is explicitly designed to
+	// accumulate conflicting configs per hostname rather than have the latest win.
+	r.Delete(testNamespace, "conflict.example.com", b)
+
+	matches := r.Lookup(testNamespace, "conflict.example.com")["conflict.example.com"]
+	if len(matches) != 2 {
+		t.Fatalf("Lookup after Delete(b) -> wanted 2 remaining configs, got %#v", matches)
+	}
+	wantOrder := []string{"a", "c"}
+	for i, want := range wantOrder {
+		if matches[i].Name != want {
+			t.Errorf("Lookup after Delete(b) -> position %d: wanted %v, got %v", i, want, matches[i].Name)
+		}
+	}
+
+	// Deleting the last remaining config under a hostname removes the hostname entirely.
+	r.Delete(testNamespace, "conflict.example.com", a)
+	r.Delete(testNamespace, "conflict.example.com", c)
+	if configs := r.Lookup(testNamespace, "conflict.example.com"); len(configs) != 0 {
+		t.Errorf("Lookup after deleting every config -> wanted no match, got %#v", configs)
+	}
+
+	// Deleting a config that was never inserted, or from a hostname that was never indexed,
+	// is a no-op rather than an error.
+	r.Delete(testNamespace, "conflict.example.com", a)
+	r.Delete(testNamespace, "never.example.com", a)
+}
+
+func TestRadixDeleteDoesNotMutateHeldSnapshot(t *testing.T) {
+	r := newRadix()
+	a := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "a", CreationTimestamp: time.Unix(1, 0)}}
+	b := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "b", CreationTimestamp: time.Unix(2, 0)}}
+	d := Config{ConfigMeta: ConfigMeta{Namespace: "default", Name: "d", CreationTimestamp: time.Unix(0, 0)}}
+
+	r.Insert(testNamespace, "conflict.example.com", a)
+	r.Insert(testNamespace, "conflict.example.com", b)
+	r.Delete(testNamespace, "conflict.example.com", b)
+
+	// Snapshot taken right after the Delete: it must keep seeing exactly [a] even though an
+	// Insert runs afterwards. If removeConfig's result slice (now holding just "a") still had
+	// spare capacity left over from the pre-delete [a, b] slice, the Insert below could shift
+	// "a" along and write "d" (older, so sorted first) into that same backing array instead of
+	// allocating a new one, corrupting what this snapshot reads.
+	snap := r.Snapshot()
+	r.Insert(testNamespace, "conflict.example.com", d)
+
+	matches := snap.Lookup(testNamespace, "conflict.example.com")["conflict.example.com"]
+	if len(matches) != 1 || matches[0].Name != "a" {
+		t.Errorf("Snapshot taken after Delete, before a later Insert -> wanted unchanged [a], got %#v", matches)
+	}
+}
+
+func TestRadixConcurrentReadersDuringDelete(t *testing.T) {
+	r := newRadix()
+	configs := make([]Config, 50)
+	for i := 0; i < 50; i++ {
+		configs[i] = Config{ConfigMeta: ConfigMeta{Name: fmt.Sprintf("config-%d", i)}}
+		r.Insert(testNamespace, Hostname(fmt.Sprintf("*/host-%d.example.com", i)), configs[i])
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+
+	// Every reader holds its own Snapshot for the whole loop: the snapshot must keep returning
+	// a complete, internally consistent tree even while Delete below is removing entries.
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := r.Snapshot()
+				for j := 0; j < 50; j++ {
+					hostname := Hostname(fmt.Sprintf("host-%d.example.com", j))
+					for _, matches := range snap.Lookup(testNamespace, hostname) {
+						if len(matches) != 1 {
+							t.Errorf("Lookup(%v) during Delete -> wanted at most 1 config, got %#v", hostname, matches)
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for j := 0; j < 50; j++ {
+			hostname := Hostname(fmt.Sprintf("*/host-%d.example.com", j))
+			r.Delete(testNamespace, hostname, configs[j])
+		}
+	}()
+
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	if configs := r.Lookup(testNamespace, "*"); len(configs) != 0 {
+		t.Errorf("Lookup(*) after deleting everything -> wanted no matches, got %#v", configs)
+	}
+}
+
+func TestRadixBulkReplaceNamespaceScoping(t *testing.T) {
+	r := newRadix()
+
+	plain := Config{ConfigMeta: ConfigMeta{Name: "plain"}}
+	selfNS := Config{ConfigMeta: ConfigMeta{Name: "self-ns"}}
+	otherNS := Config{ConfigMeta: ConfigMeta{Name: "other-ns"}}
+	anyNS := Config{ConfigMeta: ConfigMeta{Name: "any-ns"}}
+
+	r.BulkReplace([]radixEntry{
+		// A plain hostname, with no "/", is the ordinary shape of an existing Istio host
+		// string; it must resolve against its entry's namespace, exactly like Insert, rather
+		// than being filed under an empty namespace no Lookup can ever reach.
+		{Namespace: "ns1", Hostname: "plain.example.com", Config: plain},
+		{Namespace: "ns1", Hostname: "./self.example.com", Config: selfNS},
+		{Namespace: "ns1", Hostname: "ns2/other.example.com", Config: otherNS},
+		{Namespace: "ns1", Hostname: "*/any.example.com", Config: anyNS},
+	})
+
+	testCases := []struct {
+		namespace string
+		in        Hostname
+		want      *Config
+	}{
+		{"ns1", "plain.example.com", &plain},
+		{"ns2", "plain.example.com", nil},
+		{"ns1", "self.example.com", &selfNS},
+		{"ns2", "self.example.com", nil},
+		{"ns2", "other.example.com", &otherNS},
+		{"ns1", "other.example.com", nil},
+		{"ns1", "any.example.com", &anyNS},
+		{"anything", "any.example.com", &anyNS},
+	}
+
+	for _, tt := range testCases {
+		configs := r.Lookup(tt.namespace, tt.in)
+		if tt.want == nil {
+			if len(configs) != 0 {
+				t.Errorf("Lookup(%v, %v) -> wanted no match, got %#v", tt.namespace, tt.in, configs)
+			}
+			continue
+		}
+		matches, ok := configs[tt.in]
+		if !ok || len(matches) != 1 || matches[0].Name != tt.want.Name {
+			t.Errorf("Lookup(%v, %v) -> wanted %v, got %#v", tt.namespace, tt.in, tt.want.Name, configs)
+		}
+	}
+}
+
+func TestRadixConcurrentReadersDuringBulkReplace(t *testing.T) {
+	r := newRadix()
+	for i := 0; i < 50; i++ {
+		hostname := Hostname(fmt.Sprintf("*/host-%d.example.com", i))
+		r.Insert(testNamespace, hostname, Config{ConfigMeta: ConfigMeta{Name: fmt.Sprintf("initial-%d", i)}})
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+
+	// Every reader holds its own Snapshot for the whole loop: the snapshot must keep
+	// returning a complete, internally consistent tree even while BulkReplace below is
+	// swapping in a wholly different one.
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := r.Snapshot()
+				for j := 0; j < 50; j++ {
+					hostname := Hostname(fmt.Sprintf("host-%d.example.com", j))
+					configs := snap.Lookup(testNamespace, hostname)
+					for _, matches := range configs {
+						if len(matches) != 1 {
+							t.Errorf("Lookup(%v) during BulkReplace -> wanted exactly 1 config, got %#v", hostname, matches)
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for round := 0; round < 20; round++ {
+			entries := make([]radixEntry, 50)
+			for j := 0; j < 50; j++ {
+				hostname := Hostname(fmt.Sprintf("*/host-%d.example.com", j))
+				entries[j] = radixEntry{
+					Namespace: testNamespace,
+					Hostname:  hostname,
+					Config:    Config{ConfigMeta: ConfigMeta{Name: fmt.Sprintf("round-%d-%d", round, j)}},
+				}
+			}
+			r.BulkReplace(entries)
+		}
+	}()
+
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+}